@@ -1,212 +1,100 @@
 package main
 
 import (
-	"bufio"
 	"context"
-	"fmt"
-	"io"
+	"flag"
 	"log"
 	"os"
 	"strings"
-	"sync"
 	"time"
 
 	lite "github.com/eatonphil/gosqlite"
-	"github.com/jackc/pgx/v5/pgconn"
-)
-
-const kBatchSize = 50
 
-func copyTable(wg *sync.WaitGroup, lock *sync.Mutex, db string, replica *lite.Conn, table string, columns ...string) {
-	r, w := io.Pipe()
-	go parseTable(wg, lock, r, replica, table, columns)
+	"github.com/tmm/mono/go/pkg/pgcopy"
+)
 
-	pg, err := pgconn.Connect(context.Background(), db)
-	if err != nil {
-		log.Fatalf("Connect error: %v", err)
-	}
+func main() {
+	upstream := flag.String("upstream", os.Getenv("ZERO_UPSTREAM_DB"), "upstream Postgres DSN")
+	replicaPath := flag.String("replica", "/tmp/initial-sync.db", "path to the SQLite replica")
+	batchSize := flag.Int("batch-size", 50, "rows per INSERT batch")
+	workers := flag.Int("workers", 1, "concurrent COPY streams per table")
+	tablesFlag := flag.String("tables", "issue,comment,issueLabel", "comma-separated table names to copy, or * for every table")
+	follow := flag.Bool("follow", false, "after the initial copy, stream further changes from a logical replication slot (requires a PUBLICATION named --slot to already exist upstream, e.g. CREATE PUBLICATION initial_sync FOR ALL TABLES)")
+	slot := flag.String("slot", "initial_sync", "logical replication slot to create and follow, and the PUBLICATION name it decodes with (used when --follow is set; the publication must already exist upstream)")
+	flag.Parse()
 
-	if err = pg.Exec(context.Background(), "BEGIN ISOLATION LEVEL REPEATABLE READ READ ONLY").Close(); err != nil {
-		log.Fatalf("BEGIN error: %v", err)
+	if *upstream == "" {
+		log.Fatalf("no upstream DSN (set --upstream or ZERO_UPSTREAM_DB)")
 	}
 
-	_, err = pg.CopyTo(context.Background(), w,
-		fmt.Sprintf(`COPY (SELECT %s FROM "%s") TO STDOUT`, strings.Join(columns, ","), table))
+	ctx := context.Background()
+	specs, ddl, err := pgcopy.IntrospectTables(ctx, *upstream, strings.Split(*tablesFlag, ","))
 	if err != nil {
-		log.Fatalf("COPY error: %v", err)
-	}
-	if err = w.Close(); err != nil {
-		log.Fatalf("writer close error: %v", err)
-	}
-	if err = pg.Exec(context.Background(), "COMMIT").Close(); err != nil {
-		log.Fatalf("COMMIT error: %v", err)
-	}
-	if err = pg.Close(context.Background()); err != nil {
-		log.Fatalf("pg close error: %v", err)
+		log.Fatalf("introspect schema: %v", err)
+	}
+
+	// A resuming --follow run has already created the schema and has a
+	// _repl_state row to pick up from; recreating the schema here would
+	// drop everything the previous run streamed in. A replica file can
+	// exist without that row (e.g. a crash mid initial COPY), so the
+	// check has to be the same one Copier.Run itself uses to decide
+	// whether to resume, not just "does the file exist".
+	resuming := false
+	if *follow {
+		if resuming, err = pgcopy.HasResumableState(*replicaPath, *slot); err != nil {
+			log.Fatalf("check resume state: %v", err)
+		}
 	}
-}
-
-func parseTable(wg *sync.WaitGroup, lock *sync.Mutex, r io.Reader, replica *lite.Conn, table string, columns []string) {
-	defer wg.Done()
-	start := time.Now()
-	numCols := len(columns)
-	vals := make([]any, kBatchSize*numCols)
-	pos := 0
-	rows := 0
-	var flushTime time.Duration = 0
-
-	qs := make([]string, numCols)
-	for i := range qs {
-		qs[i] = "?"
+	if !resuming {
+		if err = createSchema(*replicaPath, ddl); err != nil {
+			log.Fatalf("create schema: %v", err)
+		}
 	}
 
-	valuesStr := fmt.Sprintf("(%s)", strings.Join(qs, ","))
-	insertStr := fmt.Sprintf(`INSERT INTO "%s" (%s) VALUES %s`, table, strings.Join(columns, ","), valuesStr)
-	insertBatchStr := fmt.Sprintf("%s%s", insertStr, strings.Repeat(","+valuesStr, kBatchSize-1))
+	copier := pgcopy.New(pgcopy.Options{
+		UpstreamDSN: *upstream,
+		ReplicaPath: *replicaPath,
+		BatchSize:   *batchSize,
+		Workers:     *workers,
+		Tables:      specs,
+		Follow:      *follow,
+		SlotName:    *slot,
+	})
 
-	lock.Lock()
-	insertStmt, err := replica.Prepare(insertStr)
-	if err != nil {
-		log.Fatalf("prepare insert %v", err)
-	}
-	insertBatchStmt, err := replica.Prepare(insertBatchStr)
+	start := time.Now()
+	results, err := copier.Run(ctx)
 	if err != nil {
-		log.Fatalf("prepare insert batch %v", err)
-	}
-	lock.Unlock()
-
-	for lines := bufio.NewScanner(r); lines.Scan(); {
-		row := strings.Split(lines.Text(), "\t")
-		if len(row) != numCols {
-			log.Fatalf("expected %d values in row %s", len(columns), row)
-		}
-		for i, v := range row {
-			if v == "\\N" {
-				vals[pos+i] = nil
-			} else {
-				vals[pos+i] = v
-			}
-		}
-		pos += len(row)
-		rows++
-		if rows%kBatchSize == 0 {
-			s := time.Now()
-			lock.Lock()
-			if err = insertBatchStmt.Exec(vals...); err != nil {
-				log.Fatalf("insert batch %s", err)
-			}
-			lock.Unlock()
-			flushTime += time.Since(s)
-			pos = 0
-		}
+		log.Fatalf("sync: %v", err)
 	}
-	for i := range rows % kBatchSize {
-		s := time.Now()
-		lock.Lock()
-		if err = insertStmt.Exec(vals[i*numCols : ((i + 1) * numCols)]...); err != nil {
-			log.Fatalf("insert %s", err)
-		}
-		lock.Unlock()
-		flushTime += time.Since(s)
+	for _, spec := range specs {
+		res := results[spec.Name]
+		log.Printf("Finished writing %d %s rows (flush: %s)", res.RowsCopied, spec.Name, res.FlushDuration)
 	}
-	log.Printf("Finished writing %d %s rows (flush: %s) (total: %s)", rows, table, flushTime, time.Since(start))
+	log.Printf("Copy took %s", time.Since(start))
 }
 
-func main() {
-	replica, err := lite.Open("/tmp/initial-sync.db")
+// createSchema (re)creates the SQLite replica's tables from ddl, as
+// produced by pgcopy.IntrospectTables, and switches the file to
+// journal_mode = WAL, which is stored in the file itself and so keeps it
+// recoverable after a crash mid-transaction for a resumed --follow run.
+// The other pragmas here are per-connection settings: they apply only to
+// this connection, which is closed before the copy, not to the one
+// Copier.Run opens.
+func createSchema(replicaPath, ddl string) error {
+	replica, err := lite.Open(replicaPath)
 	if err != nil {
-		log.Fatalf("Open error: %v", err)
+		return err
 	}
-	if err = replica.Exec(`
-	DROP TABLE IF EXISTS issue;
-	CREATE TABLE issue (
-		id VARCHAR,
-		shortID INTEGER,
-		title VARCHAR,
-		open BOOLEAN,
-		modified DOUBLE,
-		created DOUBLE,
-		creatorID VARCHAR,
-		assigneeID VARCHAR,
-		description VARCHAR,
-		visibility VARCHAR,
-		testJson JSONB
-	);
-
-	DROP TABLE IF EXISTS comment;
-	CREATE TABLE comment (
-		id VARCHAR,
-		issueID INTEGER,
-		created DOUBLE,
-		body TEXT,
-		creatorID VARCHAR
-	);
-
-	DROP TABLE IF EXISTS issueLabel;
-	CREATE TABLE issueLabel (
-		labelID VARCHAR,
-		issueID INTEGER
-	);
-	`); err != nil {
-		log.Fatalf("CREATEs: %v", err)
+	if err = replica.Exec(ddl); err != nil {
+		return err
 	}
-
 	if err = replica.Exec(`
 	PRAGMA locking_mode = EXCLUSIVE;
 	PRAGMA foreign_keys = OFF;
-	PRAGMA journal_mode = OFF;
-	PRAGMA synchronous = OFF;
+	PRAGMA journal_mode = WAL;
+	PRAGMA synchronous = NORMAL;
 	`); err != nil {
-		log.Fatalf("PRAGMAS: %v", err)
-	}
-
-	db, found := os.LookupEnv("ZERO_UPSTREAM_DB")
-	if !found {
-		log.Fatalf("No ZERO_UPSTREAM_DB")
-	}
-
-	if err = replica.Exec("BEGIN"); err != nil {
-		log.Fatalf("BEGIN: %v", err)
+		return err
 	}
-
-	start := time.Now()
-
-	var wg sync.WaitGroup
-	wg.Add(3)
-
-	var lock sync.Mutex
-
-	go copyTable(&wg, &lock, db, replica, "issue",
-		"\"id\"",
-		"\"shortID\"",
-		"\"title\"",
-		"\"open\"",
-		"\"modified\"",
-		"\"created\"",
-		"\"creatorID\"",
-		"\"assigneeID\"",
-		"\"description\"",
-		"\"visibility\"",
-		"\"testJson\"",
-	)
-
-	go copyTable(&wg, &lock, db, replica, "comment",
-		"\"id\"",
-		"\"issueID\"",
-		"\"created\"",
-		"\"body\"",
-		"\"creatorID\"",
-	)
-
-	go copyTable(&wg, &lock, db, replica, "issueLabel",
-		"\"labelID\"",
-		"\"issueID\"",
-	)
-
-	wg.Wait()
-
-	if err = replica.Exec("COMMIT"); err != nil {
-		log.Fatalf("COMMIT: %v", err)
-	}
-	log.Printf("Copy took %s", time.Since(start))
+	return replica.Close()
 }
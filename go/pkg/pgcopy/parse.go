@@ -0,0 +1,121 @@
+package pgcopy
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// parseTable reads tab-separated COPY output from r and batches it into
+// INSERTs run through w. Batches are double-buffered: while one batch is
+// queued on w (waiting for the single writer goroutine to get to it),
+// this goroutine fills the other, so INSERT execution and COPY parsing
+// overlap instead of serializing on a lock.
+func (c *Copier) parseTable(w *writer, r io.Reader, spec TableSpec) (Result, error) {
+	start := time.Now()
+	batchSize := c.opts.BatchSize
+	columns := spec.Columns
+	numCols := len(columns)
+	rows := 0
+	var flushTime time.Duration
+	var flushMu sync.Mutex
+
+	qs := make([]string, numCols)
+	for i := range qs {
+		qs[i] = "?"
+	}
+	valuesStr := fmt.Sprintf("(%s)", strings.Join(qs, ","))
+	insertStr := fmt.Sprintf(`INSERT INTO "%s" (%s) VALUES %s`, spec.Name, strings.Join(columns, ","), valuesStr)
+	insertBatchStr := fmt.Sprintf("%s%s", insertStr, strings.Repeat(","+valuesStr, batchSize-1))
+
+	insertStmt, err := w.prepare(insertStr)
+	if err != nil {
+		return Result{}, fmt.Errorf("prepare insert: %w", err)
+	}
+	insertBatchStmt, err := w.prepare(insertBatchStr)
+	if err != nil {
+		return Result{}, fmt.Errorf("prepare insert batch: %w", err)
+	}
+
+	var bufs [2][]any
+	bufs[0] = make([]any, batchSize*numCols)
+	bufs[1] = make([]any, batchSize*numCols)
+	var inflight [2]chan error
+	cur := 0
+	pos := 0
+
+	// wait blocks until buffer i's previously queued batch, if any, has
+	// been written, and clears it so it isn't waited on twice.
+	wait := func(i int) error {
+		if inflight[i] == nil {
+			return nil
+		}
+		err := <-inflight[i]
+		inflight[i] = nil
+		return err
+	}
+
+	// flush hands buf to w in the background and returns a channel that
+	// receives its result, so the caller can go on filling the other
+	// buffer without waiting for the INSERT to actually run.
+	flush := func(buf []any) chan error {
+		done := make(chan error, 1)
+		go func() {
+			s := time.Now()
+			err := w.execStmt(insertBatchStmt, buf)
+			flushMu.Lock()
+			flushTime += time.Since(s)
+			flushMu.Unlock()
+			done <- err
+		}()
+		return done
+	}
+
+	for lines := bufio.NewScanner(r); lines.Scan(); {
+		if pos == 0 {
+			if err := wait(cur); err != nil {
+				return Result{}, fmt.Errorf("insert batch: %w", err)
+			}
+		}
+
+		row := strings.Split(lines.Text(), "\t")
+		if len(row) != numCols {
+			return Result{}, fmt.Errorf("expected %d values in row %v", numCols, row)
+		}
+		for i, v := range row {
+			if v == "\\N" {
+				bufs[cur][pos+i] = nil
+			} else {
+				bufs[cur][pos+i] = v
+			}
+		}
+		pos += len(row)
+		rows++
+
+		if rows%batchSize == 0 {
+			inflight[cur] = flush(bufs[cur])
+			cur = 1 - cur
+			pos = 0
+		}
+	}
+
+	if err := wait(0); err != nil {
+		return Result{}, fmt.Errorf("insert batch: %w", err)
+	}
+	if err := wait(1); err != nil {
+		return Result{}, fmt.Errorf("insert batch: %w", err)
+	}
+
+	for i := range rows % batchSize {
+		s := time.Now()
+		if err := w.execStmt(insertStmt, bufs[cur][i*numCols:(i+1)*numCols]); err != nil {
+			return Result{}, fmt.Errorf("insert: %w", err)
+		}
+		flushTime += time.Since(s)
+	}
+
+	return Result{RowsCopied: rows, Duration: time.Since(start), FlushDuration: flushTime}, nil
+}
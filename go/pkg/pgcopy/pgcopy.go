@@ -0,0 +1,190 @@
+// Package pgcopy copies a set of Postgres tables into a SQLite replica,
+// with one or more COPY streams per table. Each stream runs in a
+// REPEATABLE READ transaction; with Options.Follow every stream adopts the
+// replication slot's exported snapshot, otherwise each table's streams
+// take their own snapshot.
+package pgcopy
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	lite "github.com/eatonphil/gosqlite"
+	"github.com/jackc/pglogrepl"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+const defaultBatchSize = 50
+
+// TableSpec describes a single table to copy from the upstream Postgres
+// database into the SQLite replica.
+type TableSpec struct {
+	// Name is the table name, double-quoted in both the COPY and INSERT
+	// statements.
+	Name string
+	// Columns are the columns to copy, in order. Each entry is used
+	// verbatim in the generated SQL, so callers are responsible for
+	// quoting (e.g. `"creatorID"`) where Postgres or SQLite need it.
+	Columns []string
+	// PK is the primary key column used to shard the COPY across
+	// Workers concurrent streams when it's numeric or a UUID. Tables
+	// with no PK, or a PK of another type, always copy with one stream.
+	PK string
+}
+
+// Result reports the outcome of copying a single table.
+type Result struct {
+	RowsCopied    int
+	Duration      time.Duration
+	FlushDuration time.Duration
+}
+
+// Options configures a Copier.
+type Options struct {
+	// UpstreamDSN is the Postgres connection string to copy from.
+	UpstreamDSN string
+	// ReplicaPath is the path to the SQLite database file to copy into.
+	// The replica's schema must already exist; Copier only writes rows,
+	// apart from the _repl_state table it creates when Follow is set.
+	ReplicaPath string
+	// BatchSize is the number of rows batched into a single INSERT.
+	// Defaults to 50.
+	BatchSize int
+	// Workers is the number of concurrent COPY streams to shard each
+	// table across, when its PK allows it. Defaults to 1.
+	Workers int
+	// Tables are the tables to copy, each started in its own goroutine.
+	Tables []TableSpec
+
+	// Follow, when set, turns Run into snapshot-then-follow: after the
+	// initial COPY, Run switches into a streaming loop that applies WAL
+	// changes from a logical replication slot until ctx is canceled.
+	Follow bool
+	// SlotName is the logical replication slot to follow. Required when
+	// Follow is set. Run creates the slot unless the replica already has a
+	// confirmed LSN recorded for it; creating a slot that already exists
+	// upstream fails.
+	SlotName string
+	// Publication is the PUBLICATION the slot decodes with pgoutput.
+	// Defaults to SlotName when empty. The publication itself must
+	// already exist upstream (e.g. CREATE PUBLICATION <name> FOR ALL
+	// TABLES) — Run only creates the replication slot, not this.
+	Publication string
+}
+
+// Copier copies a snapshot of a set of Postgres tables into a SQLite
+// replica.
+type Copier struct {
+	opts Options
+}
+
+// New returns a Copier configured with opts, filling in defaults for any
+// zero-valued fields.
+func New(opts Options) *Copier {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaultBatchSize
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = 1
+	}
+	if opts.Follow && opts.Publication == "" {
+		opts.Publication = opts.SlotName
+	}
+	return &Copier{opts: opts}
+}
+
+// Run opens the SQLite replica and copies every configured table from the
+// upstream Postgres database through CopyTable, whose streams each run in
+// a REPEATABLE READ transaction, returning a Result per table name. If any
+// table fails, Run returns the first error but still reports Results for
+// the tables that succeeded.
+//
+// If Options.Follow is set, the COPY adopts the consistent snapshot of a
+// newly created logical replication slot, and Run does not return after
+// the COPY completes: it instead streams WAL from the slot and applies it
+// to the replica until ctx is canceled. If the replica already records a
+// confirmed LSN for the slot, Run skips the COPY, follows from that LSN,
+// and returns nil Results.
+func (c *Copier) Run(ctx context.Context) (map[string]Result, error) {
+	conn, err := lite.Open(c.opts.ReplicaPath)
+	if err != nil {
+		return nil, fmt.Errorf("open replica: %w", err)
+	}
+	w := newWriter(conn)
+	defer w.Close()
+
+	var (
+		snapshotConn *pgconn.PgConn
+		snapshot     string
+		startLSN     pglogrepl.LSN
+	)
+	if c.opts.Follow {
+		if err = ensureReplState(w); err != nil {
+			return nil, fmt.Errorf("ensure repl state: %w", err)
+		}
+		if resumeLSN, ok, err := loadReplState(w, c.opts.SlotName); err != nil {
+			return nil, fmt.Errorf("load repl state: %w", err)
+		} else if ok {
+			return nil, c.follow(ctx, w, resumeLSN)
+		}
+
+		snapshotConn, snapshot, startLSN, err = createSlot(ctx, c.opts.UpstreamDSN, c.opts.SlotName)
+		if err != nil {
+			return nil, fmt.Errorf("create replication slot: %w", err)
+		}
+	}
+
+	if err = w.exec("BEGIN"); err != nil {
+		return nil, fmt.Errorf("begin replica transaction: %w", err)
+	}
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		results  = make(map[string]Result, len(c.opts.Tables))
+		firstErr error
+	)
+	wg.Add(len(c.opts.Tables))
+
+	for _, spec := range c.opts.Tables {
+		go func(spec TableSpec) {
+			defer wg.Done()
+			res, err := c.CopyTable(ctx, w, spec, snapshot)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				if firstErr == nil {
+					firstErr = fmt.Errorf("copy %s: %w", spec.Name, err)
+				}
+				return
+			}
+			results[spec.Name] = res
+		}(spec)
+	}
+
+	wg.Wait()
+	if c.opts.Follow {
+		if err = snapshotConn.Close(ctx); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("close snapshot connection: %w", err)
+		}
+	}
+	if firstErr != nil {
+		return results, firstErr
+	}
+
+	if err = w.exec("COMMIT"); err != nil {
+		return results, fmt.Errorf("commit replica transaction: %w", err)
+	}
+
+	if !c.opts.Follow {
+		return results, nil
+	}
+
+	if err = saveReplState(w, c.opts.SlotName, startLSN); err != nil {
+		return results, fmt.Errorf("save repl state: %w", err)
+	}
+	return results, c.follow(ctx, w, startLSN)
+}
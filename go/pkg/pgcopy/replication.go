@@ -0,0 +1,421 @@
+package pgcopy
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	lite "github.com/eatonphil/gosqlite"
+	"github.com/jackc/pglogrepl"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgproto3"
+)
+
+const (
+	replStateTable        = "_repl_state"
+	standbyStatusInterval = 10 * time.Second
+)
+
+// createSlot opens a dedicated replication connection and creates a
+// logical replication slot decoding with the pgoutput plugin, exporting
+// its consistent snapshot so the caller's COPY can adopt it via SET
+// TRANSACTION SNAPSHOT. The returned connection must stay open until every
+// CopyTable using the snapshot has finished; Postgres only honors an
+// exported snapshot for the lifetime of the session that created it.
+func createSlot(ctx context.Context, dsn, slotName string) (*pgconn.PgConn, string, pglogrepl.LSN, error) {
+	pg, err := pgconn.Connect(ctx, dsn+" replication=database")
+	if err != nil {
+		return nil, "", 0, fmt.Errorf("connect (replication): %w", err)
+	}
+
+	res, err := pglogrepl.CreateReplicationSlot(ctx, pg, slotName, "pgoutput",
+		pglogrepl.CreateReplicationSlotOptions{SnapshotAction: "export"})
+	if err != nil {
+		pg.Close(ctx)
+		return nil, "", 0, fmt.Errorf("create replication slot %s: %w", slotName, err)
+	}
+
+	startLSN, err := pglogrepl.ParseLSN(res.ConsistentPoint)
+	if err != nil {
+		pg.Close(ctx)
+		return nil, "", 0, fmt.Errorf("parse consistent point: %w", err)
+	}
+	return pg, res.SnapshotName, startLSN, nil
+}
+
+// follow streams WAL from c.opts.SlotName starting at lsn, applying every
+// change through w until ctx is canceled. The confirmed LSN is persisted
+// to _repl_state after each message so a restart resumes from here rather
+// than re-running the initial COPY.
+func (c *Copier) follow(ctx context.Context, w *writer, lsn pglogrepl.LSN) error {
+	pg, err := pgconn.Connect(ctx, c.opts.UpstreamDSN+" replication=database")
+	if err != nil {
+		return fmt.Errorf("connect (replication): %w", err)
+	}
+	defer pg.Close(ctx)
+
+	pluginArgs := []string{
+		"proto_version '1'",
+		fmt.Sprintf("publication_names '%s'", c.opts.Publication),
+	}
+	if err = pglogrepl.StartReplication(ctx, pg, c.opts.SlotName, lsn, pglogrepl.StartReplicationOptions{PluginArgs: pluginArgs}); err != nil {
+		return fmt.Errorf("start replication: %w", err)
+	}
+
+	relations := make(map[uint32]*pglogrepl.RelationMessage)
+	apply := newApplier(w, c.opts.Tables)
+	state := newReplState(w, c.opts.SlotName)
+	lastStandby := time.Now()
+
+	for {
+		if time.Since(lastStandby) > standbyStatusInterval {
+			if err = pglogrepl.SendStandbyStatusUpdate(ctx, pg, pglogrepl.StandbyStatusUpdate{WALWritePosition: lsn}); err != nil {
+				return fmt.Errorf("send standby status: %w", err)
+			}
+			lastStandby = time.Now()
+		}
+
+		recvCtx, cancel := context.WithDeadline(ctx, lastStandby.Add(standbyStatusInterval))
+		msg, err := pg.ReceiveMessage(recvCtx)
+		cancel()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			if pgconn.Timeout(err) {
+				continue
+			}
+			return fmt.Errorf("receive message: %w", err)
+		}
+
+		cd, ok := msg.(*pgproto3.CopyData)
+		if !ok || len(cd.Data) == 0 {
+			continue
+		}
+
+		switch cd.Data[0] {
+		case pglogrepl.PrimaryKeepaliveMessageByteID:
+			ka, err := pglogrepl.ParsePrimaryKeepaliveMessage(cd.Data[1:])
+			if err != nil {
+				return fmt.Errorf("parse keepalive: %w", err)
+			}
+			if ka.ReplyRequested {
+				lastStandby = time.Time{}
+			}
+
+		case pglogrepl.XLogDataByteID:
+			xld, err := pglogrepl.ParseXLogData(cd.Data[1:])
+			if err != nil {
+				return fmt.Errorf("parse xlog data: %w", err)
+			}
+
+			logical, err := pglogrepl.Parse(xld.WALData)
+			if err != nil {
+				return fmt.Errorf("parse logical message: %w", err)
+			}
+			if err = apply.apply(logical, relations); err != nil {
+				return fmt.Errorf("apply %T: %w", logical, err)
+			}
+
+			lsn = xld.WALStart + pglogrepl.LSN(len(xld.WALData))
+			if err = state.save(lsn); err != nil {
+				return fmt.Errorf("save repl state: %w", err)
+			}
+		}
+	}
+}
+
+// applier turns decoded pgoutput messages into SQLite statements against
+// the tables the Copier was configured with, caching one prepared
+// statement per table per operation.
+type applier struct {
+	w       *writer
+	tables  map[string]TableSpec
+	inserts map[string]*lite.Stmt
+	updates map[string]*lite.Stmt
+	deletes map[string]*lite.Stmt
+}
+
+func newApplier(w *writer, specs []TableSpec) *applier {
+	tables := make(map[string]TableSpec, len(specs))
+	for _, spec := range specs {
+		tables[spec.Name] = spec
+	}
+	return &applier{
+		w:       w,
+		tables:  tables,
+		inserts: make(map[string]*lite.Stmt),
+		updates: make(map[string]*lite.Stmt),
+		deletes: make(map[string]*lite.Stmt),
+	}
+}
+
+func (a *applier) apply(msg pglogrepl.Message, relations map[uint32]*pglogrepl.RelationMessage) error {
+	switch m := msg.(type) {
+	case *pglogrepl.RelationMessage:
+		relations[m.RelationID] = m
+		return nil
+
+	case *pglogrepl.InsertMessage:
+		spec, ok := a.spec(relations, m.RelationID)
+		if !ok {
+			return nil
+		}
+		return a.insert(spec, m.Tuple)
+
+	case *pglogrepl.UpdateMessage:
+		spec, ok := a.spec(relations, m.RelationID)
+		if !ok {
+			return nil
+		}
+		rel := relations[m.RelationID]
+		return a.update(spec, rel, m.NewTuple)
+
+	case *pglogrepl.DeleteMessage:
+		spec, ok := a.spec(relations, m.RelationID)
+		if !ok {
+			return nil
+		}
+		rel := relations[m.RelationID]
+		return a.delete(spec, rel, m.OldTuple)
+	}
+	return nil
+}
+
+func (a *applier) spec(relations map[uint32]*pglogrepl.RelationMessage, relationID uint32) (TableSpec, bool) {
+	rel, ok := relations[relationID]
+	if !ok {
+		return TableSpec{}, false
+	}
+	spec, ok := a.tables[rel.RelationName]
+	return spec, ok
+}
+
+func (a *applier) insert(spec TableSpec, tuple *pglogrepl.TupleData) error {
+	stmt, ok := a.inserts[spec.Name]
+	if !ok {
+		qs := make([]string, len(spec.Columns))
+		for i := range qs {
+			qs[i] = "?"
+		}
+		sql := fmt.Sprintf(`INSERT OR REPLACE INTO "%s" (%s) VALUES (%s)`,
+			spec.Name, strings.Join(spec.Columns, ","), strings.Join(qs, ","))
+		var err error
+		if stmt, err = a.w.prepare(sql); err != nil {
+			return fmt.Errorf("prepare insert: %w", err)
+		}
+		a.inserts[spec.Name] = stmt
+	}
+	return a.w.execStmt(stmt, tupleValues(tuple))
+}
+
+func (a *applier) update(spec TableSpec, rel *pglogrepl.RelationMessage, tuple *pglogrepl.TupleData) error {
+	if spec.PK == "" {
+		return fmt.Errorf("table %s has no single-column primary key to apply updates by", spec.Name)
+	}
+	stmt, ok := a.updates[spec.Name]
+	if !ok {
+		sets := make([]string, len(spec.Columns))
+		for i, col := range spec.Columns {
+			sets[i] = fmt.Sprintf("%s = ?", col)
+		}
+		sql := fmt.Sprintf(`UPDATE "%s" SET %s WHERE "%s" = ?`, spec.Name, strings.Join(sets, ","), spec.PK)
+		var err error
+		if stmt, err = a.w.prepare(sql); err != nil {
+			return fmt.Errorf("prepare update: %w", err)
+		}
+		a.updates[spec.Name] = stmt
+	}
+
+	vals := tupleValues(tuple)
+	pk, err := pkValue(rel, tuple, spec.PK)
+	if err != nil {
+		return fmt.Errorf("update %s: %w", spec.Name, err)
+	}
+	return a.w.execStmt(stmt, append(vals, pk))
+}
+
+func (a *applier) delete(spec TableSpec, rel *pglogrepl.RelationMessage, tuple *pglogrepl.TupleData) error {
+	if spec.PK == "" {
+		return fmt.Errorf("table %s has no single-column primary key to apply deletes by", spec.Name)
+	}
+	stmt, ok := a.deletes[spec.Name]
+	if !ok {
+		sql := fmt.Sprintf(`DELETE FROM "%s" WHERE "%s" = ?`, spec.Name, spec.PK)
+		var err error
+		if stmt, err = a.w.prepare(sql); err != nil {
+			return fmt.Errorf("prepare delete: %w", err)
+		}
+		a.deletes[spec.Name] = stmt
+	}
+
+	pk, err := pkValue(rel, tuple, spec.PK)
+	if err != nil {
+		return fmt.Errorf("delete %s: %w", spec.Name, err)
+	}
+	return a.w.execStmt(stmt, []any{pk})
+}
+
+func pkColumnIndex(rel *pglogrepl.RelationMessage, pk string) int {
+	for i, col := range rel.Columns {
+		if col.Name == pk {
+			return i
+		}
+	}
+	return -1
+}
+
+// pkValue extracts pk's value from a decoded tuple. The new tuple on an
+// INSERT/UPDATE always holds every column, so pk's position matches its
+// ordinal in rel.Columns directly. But with the default REPLICA IDENTITY,
+// the old tuple pgoutput sends for an UPDATE or DELETE holds only the
+// replica identity (normally just the primary key) columns, in table
+// order — a much shorter tuple than rel.Columns, so pk's position there
+// is instead its ordinal among the columns rel flags as part of the key.
+func pkValue(rel *pglogrepl.RelationMessage, tuple *pglogrepl.TupleData, pk string) (any, error) {
+	vals := tupleValues(tuple)
+	if len(vals) == len(rel.Columns) {
+		if i := pkColumnIndex(rel, pk); i >= 0 {
+			return vals[i], nil
+		}
+		return nil, fmt.Errorf("column %q not found in relation %s", pk, rel.RelationName)
+	}
+
+	i := 0
+	for _, col := range rel.Columns {
+		if col.Flags&1 == 0 {
+			continue
+		}
+		if col.Name == pk {
+			if i >= len(vals) {
+				break
+			}
+			return vals[i], nil
+		}
+		i++
+	}
+	return nil, fmt.Errorf("replica identity for %s (%d columns) doesn't include key column %q", rel.RelationName, len(vals), pk)
+}
+
+// tupleValues decodes a pgoutput tuple's text-format columns the same way
+// parseTable decodes COPY's tab-separated ones: nil for SQL NULL, the raw
+// text otherwise.
+func tupleValues(tuple *pglogrepl.TupleData) []any {
+	vals := make([]any, len(tuple.Columns))
+	for i, col := range tuple.Columns {
+		if col.DataType == 'n' {
+			vals[i] = nil
+		} else {
+			vals[i] = string(col.Data)
+		}
+	}
+	return vals
+}
+
+// HasResumableState reports whether replicaPath already has a confirmed
+// LSN recorded for slot, meaning a previous Run got far enough to start
+// following and a new Run should resume via Follow rather than recreate
+// the schema and redo the initial COPY. It reports false, with no error,
+// for a replicaPath that doesn't exist yet.
+func HasResumableState(replicaPath, slot string) (bool, error) {
+	if _, err := os.Stat(replicaPath); err != nil {
+		return false, nil
+	}
+
+	conn, err := lite.Open(replicaPath)
+	if err != nil {
+		return false, fmt.Errorf("open replica: %w", err)
+	}
+	w := newWriter(conn)
+	defer w.Close()
+
+	if err = ensureReplState(w); err != nil {
+		return false, fmt.Errorf("ensure repl state: %w", err)
+	}
+	_, found, err := loadReplState(w, slot)
+	if err != nil {
+		return false, fmt.Errorf("load repl state: %w", err)
+	}
+	return found, nil
+}
+
+// ensureReplState creates the table Run persists confirmed LSNs to, if it
+// doesn't already exist.
+func ensureReplState(w *writer) error {
+	return w.exec(fmt.Sprintf(
+		`CREATE TABLE IF NOT EXISTS %s (slot VARCHAR PRIMARY KEY, lsn VARCHAR NOT NULL)`, replStateTable))
+}
+
+// loadReplState returns the last confirmed LSN for slot, if Run has
+// persisted one before. It runs on the writer goroutine directly, since
+// reading a row back out isn't something prepare/execStmt cover.
+func loadReplState(w *writer, slot string) (lsn pglogrepl.LSN, found bool, err error) {
+	w.do(func() {
+		var stmt *lite.Stmt
+		if stmt, err = w.conn.Prepare(fmt.Sprintf(`SELECT lsn FROM %s WHERE slot = ?`, replStateTable)); err != nil {
+			err = fmt.Errorf("prepare: %w", err)
+			return
+		}
+		defer stmt.Close()
+
+		if err = stmt.Bind(slot); err != nil {
+			err = fmt.Errorf("bind: %w", err)
+			return
+		}
+		if found, err = stmt.Step(); err != nil {
+			err = fmt.Errorf("step: %w", err)
+			return
+		}
+		if !found {
+			return
+		}
+
+		var lsnStr string
+		if lsnStr, _, err = stmt.ColumnText(0); err != nil {
+			err = fmt.Errorf("read lsn: %w", err)
+			return
+		}
+		if lsn, err = pglogrepl.ParseLSN(lsnStr); err != nil {
+			err = fmt.Errorf("parse lsn %q: %w", lsnStr, err)
+		}
+	})
+	return lsn, found, err
+}
+
+// saveReplState persists lsn as the last confirmed position for slot.
+func saveReplState(w *writer, slot string, lsn pglogrepl.LSN) error {
+	stmt, err := w.prepare(fmt.Sprintf(
+		`INSERT INTO %s (slot, lsn) VALUES (?, ?) ON CONFLICT(slot) DO UPDATE SET lsn = excluded.lsn`, replStateTable))
+	if err != nil {
+		return fmt.Errorf("prepare: %w", err)
+	}
+	return w.execStmt(stmt, []any{slot, lsn.String()})
+}
+
+// replState caches the prepared statement behind saveReplState's INSERT so
+// follow, which saves the confirmed LSN once per WAL message for the life
+// of the process, reuses one statement instead of preparing and leaking a
+// new one on every change.
+type replState struct {
+	w    *writer
+	slot string
+	stmt *lite.Stmt
+}
+
+func newReplState(w *writer, slot string) *replState {
+	return &replState{w: w, slot: slot}
+}
+
+func (s *replState) save(lsn pglogrepl.LSN) error {
+	if s.stmt == nil {
+		stmt, err := s.w.prepare(fmt.Sprintf(
+			`INSERT INTO %s (slot, lsn) VALUES (?, ?) ON CONFLICT(slot) DO UPDATE SET lsn = excluded.lsn`, replStateTable))
+		if err != nil {
+			return fmt.Errorf("prepare: %w", err)
+		}
+		s.stmt = stmt
+	}
+	return s.w.execStmt(s.stmt, []any{s.slot, lsn.String()})
+}
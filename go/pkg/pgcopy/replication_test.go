@@ -0,0 +1,121 @@
+package pgcopy
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	lite "github.com/eatonphil/gosqlite"
+	"github.com/jackc/pglogrepl"
+)
+
+func textColumn(s string) *pglogrepl.TupleDataColumn {
+	return &pglogrepl.TupleDataColumn{DataType: 't', Data: []byte(s)}
+}
+
+func TestPkValueFullTuple(t *testing.T) {
+	// An INSERT's tuple, and an UPDATE's new tuple, always carry every
+	// column, so pk's position matches its ordinal in rel.Columns.
+	rel := &pglogrepl.RelationMessage{
+		Columns: []*pglogrepl.RelationMessageColumn{
+			{Name: "title"},
+			{Name: "id", Flags: 1},
+			{Name: "body"},
+		},
+	}
+	tuple := &pglogrepl.TupleData{
+		Columns: []*pglogrepl.TupleDataColumn{textColumn("hello"), textColumn("42"), textColumn("world")},
+	}
+
+	got, err := pkValue(rel, tuple, "id")
+	if err != nil {
+		t.Fatalf("pkValue: %v", err)
+	}
+	if got != "42" {
+		t.Errorf("pkValue = %v, want %q", got, "42")
+	}
+}
+
+func TestPkValueReplicaIdentityTuple(t *testing.T) {
+	// The old tuple pgoutput sends for an UPDATE/DELETE under the
+	// default REPLICA IDENTITY holds only the key columns, in table
+	// order, not every column, so pk's position there is its ordinal
+	// among the key-flagged columns, not its ordinal in rel.Columns.
+	rel := &pglogrepl.RelationMessage{
+		Columns: []*pglogrepl.RelationMessageColumn{
+			{Name: "title"},
+			{Name: "id", Flags: 1},
+			{Name: "body"},
+		},
+	}
+	tuple := &pglogrepl.TupleData{
+		Columns: []*pglogrepl.TupleDataColumn{textColumn("42")},
+	}
+
+	got, err := pkValue(rel, tuple, "id")
+	if err != nil {
+		t.Fatalf("pkValue: %v", err)
+	}
+	if got != "42" {
+		t.Errorf("pkValue = %v, want %q", got, "42")
+	}
+}
+
+func TestPkValueMissingKeyColumn(t *testing.T) {
+	rel := &pglogrepl.RelationMessage{
+		Columns: []*pglogrepl.RelationMessageColumn{
+			{Name: "title", Flags: 1},
+		},
+	}
+	tuple := &pglogrepl.TupleData{
+		Columns: []*pglogrepl.TupleDataColumn{textColumn("hello")},
+	}
+
+	if _, err := pkValue(rel, tuple, "id"); err == nil {
+		t.Error("pkValue: want error for a pk absent from the replica identity, got nil")
+	}
+}
+
+func TestHasResumableState(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "replica.db")
+
+	if ok, err := HasResumableState(path, "my_slot"); err != nil || ok {
+		t.Fatalf("HasResumableState(missing file) = %v, %v, want false, nil", ok, err)
+	}
+
+	conn, err := lite.Open(path)
+	if err != nil {
+		t.Fatalf("open replica: %v", err)
+	}
+	w := newWriter(conn)
+	if err := ensureReplState(w); err != nil {
+		t.Fatalf("ensure repl state: %v", err)
+	}
+	w.Close()
+
+	if ok, err := HasResumableState(path, "my_slot"); err != nil || ok {
+		t.Fatalf("HasResumableState(no row yet) = %v, %v, want false, nil", ok, err)
+	}
+
+	conn, err = lite.Open(path)
+	if err != nil {
+		t.Fatalf("reopen replica: %v", err)
+	}
+	w = newWriter(conn)
+	if err := saveReplState(w, "my_slot", pglogrepl.LSN(100)); err != nil {
+		t.Fatalf("save repl state: %v", err)
+	}
+	w.Close()
+
+	if ok, err := HasResumableState(path, "my_slot"); err != nil || !ok {
+		t.Fatalf("HasResumableState(after save) = %v, %v, want true, nil", ok, err)
+	}
+	if ok, err := HasResumableState(path, "other_slot"); err != nil || ok {
+		t.Fatalf("HasResumableState(different slot) = %v, %v, want false, nil", ok, err)
+	}
+
+	if err := os.Remove(path); err != nil {
+		t.Fatalf("remove replica: %v", err)
+	}
+}
@@ -0,0 +1,182 @@
+package pgcopy
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// IntrospectTables connects to dsn and builds a TableSpec plus CREATE TABLE
+// DDL for each requested table by reading Postgres's own catalogs, so the
+// replica schema never has to be kept in sync with upstream DDL by hand.
+// tables lists the table names to introspect, or a single "*" to pick up
+// every table in the public schema.
+func IntrospectTables(ctx context.Context, dsn string, tables []string) ([]TableSpec, string, error) {
+	pg, err := pgconn.Connect(ctx, dsn)
+	if err != nil {
+		return nil, "", fmt.Errorf("connect: %w", err)
+	}
+	defer pg.Close(ctx)
+
+	names, err := tableNames(ctx, pg, tables)
+	if err != nil {
+		return nil, "", fmt.Errorf("list tables: %w", err)
+	}
+
+	pks, err := primaryKeys(ctx, pg, names)
+	if err != nil {
+		return nil, "", fmt.Errorf("list primary keys: %w", err)
+	}
+
+	cols, err := columns(ctx, pg, names)
+	if err != nil {
+		return nil, "", fmt.Errorf("list columns: %w", err)
+	}
+
+	specs := make([]TableSpec, 0, len(names))
+	var ddl strings.Builder
+	for _, name := range names {
+		tableCols := cols[name]
+		if len(tableCols) == 0 {
+			return nil, "", fmt.Errorf("table %q has no columns (does it exist?)", name)
+		}
+
+		quoted := make([]string, len(tableCols))
+		defs := make([]string, len(tableCols))
+		for i, col := range tableCols {
+			quoted[i] = fmt.Sprintf("%q", col.name)
+			defs[i] = fmt.Sprintf("\t%s %s", col.name, pgTypeToSQLite(col.dataType))
+		}
+
+		fmt.Fprintf(&ddl, "DROP TABLE IF EXISTS %s;\nCREATE TABLE %s (\n%s\n);\n\n",
+			name, name, strings.Join(defs, ",\n"))
+
+		specs = append(specs, TableSpec{
+			Name:    name,
+			Columns: quoted,
+			PK:      pks[name],
+		})
+	}
+
+	return specs, ddl.String(), nil
+}
+
+// tableNames resolves the requested table list, expanding a single "*"
+// entry into every base table in the public schema.
+func tableNames(ctx context.Context, pg *pgconn.PgConn, tables []string) ([]string, error) {
+	if len(tables) == 1 && tables[0] == "*" {
+		rows, err := query(ctx, pg, `
+			SELECT table_name FROM information_schema.tables
+			WHERE table_schema = 'public' AND table_type = 'BASE TABLE'
+			ORDER BY table_name`)
+		if err != nil {
+			return nil, err
+		}
+		names := make([]string, len(rows))
+		for i, row := range rows {
+			names[i] = string(row[0])
+		}
+		return names, nil
+	}
+	return tables, nil
+}
+
+type columnInfo struct {
+	name     string
+	dataType string
+}
+
+// columns returns, per table name, the table's columns in ordinal order.
+func columns(ctx context.Context, pg *pgconn.PgConn, tables []string) (map[string][]columnInfo, error) {
+	rows, err := query(ctx, pg, fmt.Sprintf(`
+		SELECT table_name, column_name, data_type FROM information_schema.columns
+		WHERE table_schema = 'public' AND table_name IN (%s)
+		ORDER BY table_name, ordinal_position`, quotedList(tables)))
+	if err != nil {
+		return nil, err
+	}
+
+	cols := make(map[string][]columnInfo, len(tables))
+	for _, row := range rows {
+		table := string(row[0])
+		cols[table] = append(cols[table], columnInfo{name: string(row[1]), dataType: string(row[2])})
+	}
+	return cols, nil
+}
+
+// primaryKeys returns, per table name, the single-column primary key used
+// to shard COPYs across workers. Tables with no or composite primary keys
+// are simply absent from the result.
+func primaryKeys(ctx context.Context, pg *pgconn.PgConn, tables []string) (map[string]string, error) {
+	rows, err := query(ctx, pg, fmt.Sprintf(`
+		SELECT kcu.table_name, kcu.column_name
+		FROM information_schema.table_constraints tc
+		JOIN information_schema.key_column_usage kcu
+			ON kcu.constraint_name = tc.constraint_name AND kcu.table_schema = tc.table_schema
+		WHERE tc.constraint_type = 'PRIMARY KEY'
+			AND tc.table_schema = 'public'
+			AND tc.table_name IN (%s)`, quotedList(tables)))
+	if err != nil {
+		return nil, err
+	}
+
+	pks := make(map[string]string, len(rows))
+	seen := make(map[string]bool, len(rows))
+	for _, row := range rows {
+		table := string(row[0])
+		if seen[table] {
+			delete(pks, table) // composite key: no single column to shard on
+			continue
+		}
+		seen[table] = true
+		pks[table] = string(row[1])
+	}
+	return pks, nil
+}
+
+// query runs sql via the simple query protocol and returns every row as
+// raw text-format column values.
+func query(ctx context.Context, pg *pgconn.PgConn, sql string) ([][][]byte, error) {
+	results, err := pg.Exec(ctx, sql).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	var rows [][][]byte
+	for _, r := range results {
+		rows = append(rows, r.Rows...)
+	}
+	return rows, nil
+}
+
+func quotedList(names []string) string {
+	quoted := make([]string, len(names))
+	for i, n := range names {
+		quoted[i] = "'" + strings.ReplaceAll(n, "'", "''") + "'"
+	}
+	return strings.Join(quoted, ",")
+}
+
+// pgTypeToSQLite maps an information_schema.columns.data_type value to the
+// SQLite column affinity initial-sync stores it as.
+func pgTypeToSQLite(dataType string) string {
+	switch dataType {
+	case "ARRAY":
+		return "JSON"
+	case "jsonb", "json":
+		return "JSONB"
+	case "boolean":
+		return "BOOLEAN"
+	case "numeric":
+		return "TEXT"
+	case "integer", "bigint", "smallint":
+		return "INTEGER"
+	case "double precision", "real":
+		return "DOUBLE"
+	}
+	if strings.HasPrefix(dataType, "timestamp") {
+		return "DOUBLE"
+	}
+	return "VARCHAR"
+}
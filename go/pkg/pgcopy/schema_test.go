@@ -0,0 +1,48 @@
+package pgcopy
+
+import "testing"
+
+func TestPgTypeToSQLite(t *testing.T) {
+	cases := []struct {
+		dataType string
+		want     string
+	}{
+		{"ARRAY", "JSON"},
+		{"jsonb", "JSONB"},
+		{"json", "JSONB"},
+		{"boolean", "BOOLEAN"},
+		{"numeric", "TEXT"},
+		{"integer", "INTEGER"},
+		{"bigint", "INTEGER"},
+		{"smallint", "INTEGER"},
+		{"double precision", "DOUBLE"},
+		{"real", "DOUBLE"},
+		{"timestamp without time zone", "DOUBLE"},
+		{"timestamp with time zone", "DOUBLE"},
+		{"text", "VARCHAR"},
+		{"uuid", "VARCHAR"},
+		{"character varying", "VARCHAR"},
+	}
+	for _, c := range cases {
+		if got := pgTypeToSQLite(c.dataType); got != c.want {
+			t.Errorf("pgTypeToSQLite(%q) = %q, want %q", c.dataType, got, c.want)
+		}
+	}
+}
+
+func TestQuotedList(t *testing.T) {
+	cases := []struct {
+		names []string
+		want  string
+	}{
+		{nil, ""},
+		{[]string{"issue"}, "'issue'"},
+		{[]string{"issue", "comment"}, "'issue','comment'"},
+		{[]string{"weird's"}, "'weird''s'"},
+	}
+	for _, c := range cases {
+		if got := quotedList(c.names); got != c.want {
+			t.Errorf("quotedList(%v) = %q, want %q", c.names, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package pgcopy
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// copyTableSharded copies spec across c.opts.Workers concurrent COPY
+// streams, each restricted to a row range of spec.PK, all sharing one
+// snapshot so together they see exactly the rows a single stream would.
+// The bool return is false when the table can't be sharded (it's empty,
+// its PK isn't numeric/UUID, or its PK range yields only one shard),
+// telling the caller to fall back to a single stream.
+func (c *Copier) copyTableSharded(ctx context.Context, w *writer, spec TableSpec, snapshot string) (Result, bool, error) {
+	pg, err := pgconn.Connect(ctx, c.opts.UpstreamDSN)
+	if err != nil {
+		return Result{}, false, fmt.Errorf("connect: %w", err)
+	}
+	defer pg.Close(ctx)
+
+	if err = pg.Exec(ctx, "BEGIN ISOLATION LEVEL REPEATABLE READ READ ONLY").Close(); err != nil {
+		return Result{}, false, fmt.Errorf("begin: %w", err)
+	}
+	defer pg.Exec(ctx, "COMMIT").Close()
+
+	if snapshot != "" {
+		if err = pg.Exec(ctx, fmt.Sprintf("SET TRANSACTION SNAPSHOT '%s'", snapshot)).Close(); err != nil {
+			return Result{}, false, fmt.Errorf("set transaction snapshot: %w", err)
+		}
+	} else {
+		// Nothing to adopt: this is a plain --workers>1 run with no
+		// --follow slot behind it. Export this transaction's own
+		// snapshot and hold this connection open for the life of
+		// every shard below, so they all see exactly the rows this
+		// transaction's min/max query below saw, not whatever
+		// committed upstream in the gap between shards starting.
+		rows, err := query(ctx, pg, "SELECT pg_export_snapshot()")
+		if err != nil {
+			return Result{}, false, fmt.Errorf("export snapshot: %w", err)
+		}
+		if len(rows) != 1 {
+			return Result{}, false, fmt.Errorf("export snapshot: expected 1 row, got %d", len(rows))
+		}
+		snapshot = string(rows[0][0])
+	}
+
+	lo, hi, isUUID, ok, err := pkBounds(ctx, pg, spec)
+	if err != nil {
+		return Result{}, false, fmt.Errorf("pk bounds: %w", err)
+	}
+	if !ok {
+		return Result{}, false, nil
+	}
+
+	bounds := shardBounds(lo, hi, c.opts.Workers)
+	if len(bounds) < 3 {
+		// The PK range yields a single shard: not worth sharding.
+		return Result{}, false, nil
+	}
+
+	type shardResult struct {
+		res Result
+		err error
+	}
+	results := make(chan shardResult, len(bounds)-1)
+	var wg sync.WaitGroup
+	for i := 0; i < len(bounds)-1; i++ {
+		lo, hi := bounds[i], bounds[i+1]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			where := fmt.Sprintf(` WHERE "%s" >= %s AND "%s" < %s`,
+				spec.PK, pkLiteral(lo, isUUID), spec.PK, pkLiteral(hi, isUUID))
+			res, err := c.copyStream(ctx, w, spec, snapshot, where)
+			results <- shardResult{res, err}
+		}()
+	}
+	wg.Wait()
+	close(results)
+
+	var total Result
+	var firstErr error
+	for r := range results {
+		if r.err != nil {
+			if firstErr == nil {
+				firstErr = r.err
+			}
+			continue
+		}
+		total.RowsCopied += r.res.RowsCopied
+		total.FlushDuration += r.res.FlushDuration
+		if r.res.Duration > total.Duration {
+			total.Duration = r.res.Duration
+		}
+	}
+	return total, true, firstErr
+}
+
+// pkBounds returns the min and max of spec.PK as seen by pg's already
+// open transaction, and whether those values are numeric/UUID and
+// therefore shardable. An empty table, or a PK that is neither, reports
+// ok = false so the caller falls back to a single stream.
+func pkBounds(ctx context.Context, pg *pgconn.PgConn, spec TableSpec) (lo, hi *big.Int, isUUID, ok bool, err error) {
+	rows, err := query(ctx, pg, fmt.Sprintf(`SELECT min("%s")::text, max("%s")::text FROM "%s"`, spec.PK, spec.PK, spec.Name))
+	if err != nil {
+		return nil, nil, false, false, err
+	}
+	if len(rows) != 1 || rows[0][0] == nil || rows[0][1] == nil {
+		return nil, nil, false, false, nil
+	}
+
+	lo, isUUID, err = parsePK(string(rows[0][0]))
+	if err != nil {
+		return nil, nil, false, false, nil
+	}
+	hi, _, err = parsePK(string(rows[0][1]))
+	if err != nil {
+		return nil, nil, false, false, nil
+	}
+	return lo, hi, isUUID, true, nil
+}
+
+// parsePK parses a Postgres PK value rendered as text, either as a base-10
+// integer or a UUID, reporting which it was.
+func parsePK(s string) (*big.Int, bool, error) {
+	if n, ok := new(big.Int).SetString(s, 10); ok {
+		return n, false, nil
+	}
+	hex := strings.ReplaceAll(s, "-", "")
+	if n, ok := new(big.Int).SetString(hex, 16); ok && len(hex) == 32 {
+		return n, true, nil
+	}
+	return nil, false, fmt.Errorf("pk value %q is neither an integer nor a uuid", s)
+}
+
+// pkLiteral renders n back into a SQL literal matching its original type.
+func pkLiteral(n *big.Int, isUUID bool) string {
+	if !isUUID {
+		return n.String()
+	}
+	hex := fmt.Sprintf("%032x", n)
+	return fmt.Sprintf("'%s-%s-%s-%s-%s'", hex[0:8], hex[8:12], hex[12:16], hex[16:20], hex[20:32])
+}
+
+// shardBounds splits [lo, hi] into up to workers equal-width, half-open
+// ranges, returning the boundary points; consecutive pairs are the shard
+// ranges, with the final pair's upper bound equal to hi+1 so the last
+// shard's "< upper bound" check still includes hi itself.
+func shardBounds(lo, hi *big.Int, workers int) []*big.Int {
+	span := new(big.Int).Sub(hi, lo)
+	step := new(big.Int).Div(span, big.NewInt(int64(workers)))
+	if step.Sign() == 0 {
+		step = big.NewInt(1)
+	}
+
+	bounds := []*big.Int{new(big.Int).Set(lo)}
+	for i := 1; i < workers; i++ {
+		next := new(big.Int).Add(bounds[i-1], step)
+		if next.Cmp(hi) >= 0 {
+			break
+		}
+		bounds = append(bounds, next)
+	}
+	return append(bounds, new(big.Int).Add(hi, big.NewInt(1)))
+}
@@ -0,0 +1,97 @@
+package pgcopy
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestParsePK(t *testing.T) {
+	cases := []struct {
+		in       string
+		want     string
+		wantUUID bool
+		wantErr  bool
+	}{
+		{"0", "0", false, false},
+		{"42", "42", false, false},
+		{"170141183460469231731687303715884105727", "170141183460469231731687303715884105727", false, false},
+		{"550e8400-e29b-41d4-a716-446655440000", "113059749145936325402354257176981405696", true, false},
+		{"not-a-pk", "", false, true},
+		{"", "", false, true},
+	}
+	for _, c := range cases {
+		n, isUUID, err := parsePK(c.in)
+		if c.wantErr {
+			if err == nil {
+				t.Errorf("parsePK(%q): want error, got n=%v isUUID=%v", c.in, n, isUUID)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parsePK(%q): unexpected error: %v", c.in, err)
+			continue
+		}
+		if n.String() != c.want {
+			t.Errorf("parsePK(%q) = %v, want %v", c.in, n, c.want)
+		}
+		if isUUID != c.wantUUID {
+			t.Errorf("parsePK(%q) isUUID = %v, want %v", c.in, isUUID, c.wantUUID)
+		}
+	}
+}
+
+func TestPkLiteralRoundTrip(t *testing.T) {
+	cases := []struct {
+		in   string
+		want string
+	}{
+		{"42", "42"},
+		{"550e8400-e29b-41d4-a716-446655440000", "'550e8400-e29b-41d4-a716-446655440000'"},
+		{"00000000-0000-0000-0000-000000000000", "'00000000-0000-0000-0000-000000000000'"},
+	}
+	for _, c := range cases {
+		n, isUUID, err := parsePK(c.in)
+		if err != nil {
+			t.Fatalf("parsePK(%q): %v", c.in, err)
+		}
+		if got := pkLiteral(n, isUUID); got != c.want {
+			t.Errorf("pkLiteral(parsePK(%q)) = %q, want %q", c.in, got, c.want)
+		}
+	}
+}
+
+func TestShardBounds(t *testing.T) {
+	cases := []struct {
+		name    string
+		lo, hi  int64
+		workers int
+		want    []int64
+	}{
+		{"even split", 0, 100, 4, []int64{0, 25, 50, 75, 101}},
+		{"fewer rows than workers", 0, 1, 4, []int64{0, 2}},
+		{"single row", 5, 5, 3, []int64{5, 6}},
+		{"one worker", 0, 100, 1, []int64{0, 101}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			bounds := shardBounds(big.NewInt(c.lo), big.NewInt(c.hi), c.workers)
+			if len(bounds) != len(c.want) {
+				t.Fatalf("shardBounds(%d, %d, %d) = %v, want %v", c.lo, c.hi, c.workers, bounds, c.want)
+			}
+			for i, b := range bounds {
+				if b.Int64() != c.want[i] {
+					t.Errorf("shardBounds(%d, %d, %d)[%d] = %v, want %v", c.lo, c.hi, c.workers, i, b, c.want[i])
+				}
+			}
+			// The bounds must be strictly increasing and must cover up to hi+1.
+			if bounds[len(bounds)-1].Int64() != c.hi+1 {
+				t.Errorf("shardBounds(%d, %d, %d) last bound = %v, want %d", c.lo, c.hi, c.workers, bounds[len(bounds)-1], c.hi+1)
+			}
+			for i := 1; i < len(bounds); i++ {
+				if bounds[i].Cmp(bounds[i-1]) <= 0 {
+					t.Errorf("shardBounds(%d, %d, %d) bounds not strictly increasing: %v", c.lo, c.hi, c.workers, bounds)
+				}
+			}
+		})
+	}
+}
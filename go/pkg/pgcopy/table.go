@@ -0,0 +1,88 @@
+package pgcopy
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// CopyTable copies a single table into the SQLite replica. If the Copier
+// is configured with Workers > 1 and spec has a PK, the table is sharded
+// into concurrent row-range COPY streams; otherwise it falls back to a
+// single stream covering the whole table.
+func (c *Copier) CopyTable(ctx context.Context, w *writer, spec TableSpec, snapshot string) (Result, error) {
+	if c.opts.Workers > 1 && spec.PK != "" {
+		res, sharded, err := c.copyTableSharded(ctx, w, spec, snapshot)
+		if err != nil {
+			return Result{}, fmt.Errorf("sharded copy: %w", err)
+		}
+		if sharded {
+			return res, nil
+		}
+	}
+	return c.copyStream(ctx, w, spec, snapshot, "")
+}
+
+// copyStream runs a single COPY, optionally restricted by where (a full
+// SQL WHERE clause, or "" for the whole table), inside a REPEATABLE READ
+// READ ONLY transaction, and streams the result into the SQLite replica
+// via a parser that batches INSERTs through w. If snapshot is non-empty,
+// the transaction adopts it via SET TRANSACTION SNAPSHOT so the COPY
+// lines up with a replication slot's consistent point instead of taking
+// its own independent snapshot.
+func (c *Copier) copyStream(ctx context.Context, w *writer, spec TableSpec, snapshot, where string) (Result, error) {
+	r, pw := io.Pipe()
+
+	type parsed struct {
+		res Result
+		err error
+	}
+	parseDone := make(chan parsed, 1)
+	go func() {
+		res, err := c.parseTable(w, r, spec)
+		parseDone <- parsed{res, err}
+	}()
+
+	pg, err := pgconn.Connect(ctx, c.opts.UpstreamDSN)
+	if err != nil {
+		pw.CloseWithError(err)
+		<-parseDone
+		return Result{}, fmt.Errorf("connect: %w", err)
+	}
+	defer pg.Close(ctx)
+
+	if err = pg.Exec(ctx, "BEGIN ISOLATION LEVEL REPEATABLE READ READ ONLY").Close(); err != nil {
+		pw.CloseWithError(err)
+		<-parseDone
+		return Result{}, fmt.Errorf("begin: %w", err)
+	}
+
+	if snapshot != "" {
+		if err = pg.Exec(ctx, fmt.Sprintf("SET TRANSACTION SNAPSHOT '%s'", snapshot)).Close(); err != nil {
+			pw.CloseWithError(err)
+			<-parseDone
+			return Result{}, fmt.Errorf("set transaction snapshot: %w", err)
+		}
+	}
+
+	query := fmt.Sprintf(`COPY (SELECT %s FROM "%s"%s) TO STDOUT`, strings.Join(spec.Columns, ","), spec.Name, where)
+	if _, err = pg.CopyTo(ctx, pw, query); err != nil {
+		pw.CloseWithError(err)
+		<-parseDone
+		return Result{}, fmt.Errorf("copy: %w", err)
+	}
+	if err = pw.Close(); err != nil {
+		<-parseDone
+		return Result{}, fmt.Errorf("writer close: %w", err)
+	}
+
+	p := <-parseDone
+
+	if err = pg.Exec(ctx, "COMMIT").Close(); err != nil {
+		return p.res, fmt.Errorf("commit: %w", err)
+	}
+	return p.res, p.err
+}
@@ -0,0 +1,81 @@
+package pgcopy
+
+import lite "github.com/eatonphil/gosqlite"
+
+// defaultWriterBuffer is how many queued batches the writer channel holds
+// before a flushing goroutine blocks handing off its next one.
+const defaultWriterBuffer = 4
+
+// writer is the single goroutine allowed to touch a *lite.Conn. Every
+// other goroutine prepares statements and fills argument slices, then
+// hands the writer a job and waits for it to run — replacing a mutex
+// held for the duration of every Exec with a channel handoff, so a
+// parser can be filling its next batch while this one is still queued.
+type writer struct {
+	conn *lite.Conn
+	jobs chan func()
+	done chan struct{}
+}
+
+func newWriter(conn *lite.Conn) *writer {
+	w := &writer{
+		conn: conn,
+		jobs: make(chan func(), defaultWriterBuffer),
+		done: make(chan struct{}),
+	}
+	go func() {
+		defer close(w.done)
+		for job := range w.jobs {
+			job()
+		}
+	}()
+	return w
+}
+
+// Close stops accepting new jobs, then waits for the writer goroutine to
+// run every already-queued job and exit.
+func (w *writer) Close() {
+	close(w.jobs)
+	<-w.done
+}
+
+// exec runs sql with no arguments, for one-off statements like
+// BEGIN/COMMIT/CREATE TABLE.
+func (w *writer) exec(sql string) error {
+	errc := make(chan error, 1)
+	w.jobs <- func() { errc <- w.conn.Exec(sql) }
+	return <-errc
+}
+
+// prepare prepares sql on the writer's connection.
+func (w *writer) prepare(sql string) (*lite.Stmt, error) {
+	type result struct {
+		stmt *lite.Stmt
+		err  error
+	}
+	resc := make(chan result, 1)
+	w.jobs <- func() {
+		stmt, err := w.conn.Prepare(sql)
+		resc <- result{stmt, err}
+	}
+	r := <-resc
+	return r.stmt, r.err
+}
+
+// execStmt runs a prepared statement with vals, blocking the caller until
+// the writer has run it. It holds no lock while waiting, so other callers
+// can queue their own statements in the meantime, up to
+// defaultWriterBuffer queued jobs.
+func (w *writer) execStmt(stmt *lite.Stmt, vals []any) error {
+	errc := make(chan error, 1)
+	w.jobs <- func() { errc <- stmt.Exec(vals...) }
+	return <-errc
+}
+
+// do runs fn on the writer goroutine and waits for it to finish, for
+// operations execStmt/prepare don't cover (e.g. reading rows back out).
+func (w *writer) do(fn func()) {
+	done := make(chan struct{})
+	w.jobs <- func() { fn(); close(done) }
+	<-done
+}